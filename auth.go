@@ -0,0 +1,133 @@
+// Copyright (c) 2014, SoundCloud Ltd.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/ent
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type contextKey int
+
+const keyIDContextKey contextKey = 0
+
+// withKeyID returns a copy of ctx carrying the KeyID that authorized the
+// request, for reportMetrics to pick up.
+func withKeyID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, keyIDContextKey, id)
+}
+
+// keyIDFromContext returns the KeyID stored by withKeyID, or "" if none.
+func keyIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(keyIDContextKey).(string)
+	return id
+}
+
+// requireCapability wraps next so that it only runs once the request's
+// "Authorization: Bearer <keyID>:<secret>" header has been validated
+// against p and found to grant cap on the request's :bucket/:key.
+func requireCapability(p Provider, cap string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			bucket = r.URL.Query().Get(":bucket")
+			key    = r.URL.Query().Get(":key")
+		)
+
+		id, secret, ok := parseBearer(r.Header.Get("Authorization"))
+		if !ok {
+			respondError(w, r.Method, r.URL.String(), ErrUnauthorized)
+			return
+		}
+
+		k, err := p.AuthorizeKey(id, secret, bucket, key, cap)
+		if err != nil {
+			respondError(w, r.Method, r.URL.String(), err)
+			return
+		}
+
+		next(w, r.WithContext(withKeyID(r.Context(), k.KeyID)))
+	}
+}
+
+// parseBearer extracts the KeyID and secret from an "Authorization: Bearer
+// <keyID>:<secret>" header.
+func parseBearer(header string) (id, secret string, ok bool) {
+	const prefix = "Bearer "
+	if !strings.HasPrefix(header, prefix) {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(header, prefix), ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
+// requestKeyCreate is the body accepted by POST /keys.
+type requestKeyCreate struct {
+	Capabilities []string  `json:"capabilities"`
+	BucketName   string    `json:"bucket_name"`
+	KeyPrefix    string    `json:"key_prefix"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// ResponseKeyCreated is the response to POST /keys. Secret is only ever
+// returned here; it is not recoverable afterwards.
+type ResponseKeyCreated struct {
+	KeyID        string    `json:"key_id"`
+	Secret       string    `json:"secret"`
+	Capabilities []string  `json:"capabilities"`
+	BucketName   string    `json:"bucket_name,omitempty"`
+	KeyPrefix    string    `json:"key_prefix,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+}
+
+func handleKeyCreate(p Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		var req requestKeyCreate
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, r.Method, r.URL.String(), err)
+			return
+		}
+
+		k, secret, err := p.CreateKey(req.Capabilities, req.BucketName, req.KeyPrefix, req.ExpiresAt)
+		if err != nil {
+			respondError(w, r.Method, r.URL.String(), err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(ResponseKeyCreated{
+			KeyID:        k.KeyID,
+			Secret:       secret,
+			Capabilities: k.Capabilities,
+			BucketName:   k.BucketName,
+			KeyPrefix:    k.KeyPrefix,
+			ExpiresAt:    k.ExpiresAt,
+		})
+	}
+}
+
+func handleKeyDelete(p Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get(":id")
+
+		if err := p.DeleteKey(id); err != nil {
+			respondError(w, r.Method, r.URL.String(), err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -6,18 +6,20 @@
 package main
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/pat"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/exp"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/soundcloud/ent/fs"
 )
 
 const (
@@ -29,100 +31,328 @@ var (
 	Commit  = "0000000"
 	Version = "0.0.0"
 
-	requestBytes     = prometheus.NewCounter()
-	requestDuration  = prometheus.NewCounter()
-	requestDurations = prometheus.NewDefaultHistogram()
-	requestTotal     = prometheus.NewCounter()
-	responseBytes    = prometheus.NewCounter()
+	// keyIDAllowlist bounds which KeyIDs are reported individually on the
+	// key_id metrics label, to avoid cardinality blowups from arbitrary
+	// keys. Populated from -metrics.key-id-allowlist.
+	keyIDAllowlist = map[string]bool{}
+
+	// requestTimeout bounds how long a handler will wait on a FileSystem
+	// before its context is cancelled. Zero disables the bound.
+	// Populated from -http.request-timeout.
+	requestTimeout time.Duration
 )
 
 func main() {
 	var (
-		fsRoot      = flag.String("fs.root", "/tmp", "FileSystem root directory")
-		httpAddress = flag.String("http.addr", ":5555", "HTTP listen address")
-		providerDir = flag.String("provider.dir", "/tmp", "Provider directory with bucket policies")
+		fsBackend    = flag.String("fs.backend", "disk", "Default FileSystem backend (disk, swift, gcs, s3, b2) for buckets without one in their policy")
+		fsRoot       = flag.String("fs.disk.root", "/tmp", "Disk backend: FileSystem root directory")
+		swiftUser    = flag.String("fs.swift.username", "", "Swift backend: account username")
+		swiftKey     = flag.String("fs.swift.api-key", "", "Swift backend: account API key")
+		swiftAuthURL = flag.String("fs.swift.auth-url", "", "Swift backend: Keystone auth URL")
+		swiftTenant  = flag.String("fs.swift.tenant", "", "Swift backend: tenant name")
+		gcsProject   = flag.String("fs.gcs.project-id", "", "GCS backend: GCP project ID")
+		gcsEndpoint  = flag.String("fs.gcs.endpoint", "", "GCS backend: alternate API endpoint, e.g. a fake-gcs-server instance")
+		s3Region     = flag.String("fs.s3.region", "us-east-1", "S3 backend: AWS region")
+		b2AccountID  = flag.String("fs.b2.account-id", "", "B2 backend: account ID")
+		b2AppKey     = flag.String("fs.b2.application-key", "", "B2 backend: application key")
+		httpAddress  = flag.String("http.addr", ":5555", "HTTP listen address")
+		debugAddress = flag.String("debug.addr", ":5556", "Debug HTTP listen address (/metrics, /healthz, /readyz)")
+		providerDir  = flag.String("provider.dir", "/tmp", "Provider directory with bucket policies")
+		keyIDLabels  = flag.String("metrics.key-id-allowlist", "", "Comma-separated list of key IDs reported individually on the key_id metrics label; all others are reported as \"other\"")
+		reqTimeout   = flag.Duration("http.request-timeout", 0, "Per-request deadline propagated to the FileSystem; 0 disables it")
 	)
 	flag.Parse()
 
-	prometheus.Register("ent_requests_total", "Total number of requests made", prometheus.NilLabels, requestTotal)
-	prometheus.Register("ent_requests_duration_nanoseconds_total", "Total amount of time ent has spent to answer requests in nanoseconds", prometheus.NilLabels, requestDuration)
-	prometheus.Register("ent_requests_duration_nanoseconds", "Amounts of time ent has spent answering requests in nanoseconds", prometheus.NilLabels, requestDurations)
-	prometheus.Register("ent_request_bytes_total", "Total volume of request payloads emitted in bytes", prometheus.NilLabels, requestBytes)
-	prometheus.Register("ent_response_bytes_total", "Total volume of response payloads emitted in bytes", prometheus.NilLabels, responseBytes)
+	requestTimeout = *reqTimeout
+
+	for _, id := range strings.Split(*keyIDLabels, ",") {
+		if id != "" {
+			keyIDAllowlist[id] = true
+		}
+	}
 
 	p, err := NewDiskProvider(*providerDir)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	fs := NewDiskFS(*fsRoot)
-	r := pat.New()
-	r.Get(fileRoute, handleGet(p, fs))
-	r.Post(fileRoute, handleCreate(p, fs))
-	r.Handle("/metrics", prometheus.DefaultRegistry.Handler())
-	r.Get("/", handleBucketList(p))
+	bs, err := p.List()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, b := range bs {
+		knownBuckets[b.Name] = true
+	}
+
+	fss := newBackendSet(*fsBackend, fs.Config{
+		Disk:  fs.DiskConfig{Root: *fsRoot},
+		Swift: fs.SwiftConfig{UserName: *swiftUser, ApiKey: *swiftKey, AuthUrl: *swiftAuthURL, Tenant: *swiftTenant},
+		GCS:   fs.GCSConfig{ProjectID: *gcsProject, Endpoint: *gcsEndpoint},
+		S3:    fs.S3Config{Region: *s3Region},
+		B2:    fs.B2Config{AccountID: *b2AccountID, ApplicationKey: *b2AppKey},
+	})
 
+	r := pat.New()
+	r.Get(fileRoute, requireCapability(p, CapRead, withInflight("handleGet", handleGet(p, fss))))
+	r.Head(fileRoute, requireCapability(p, CapRead, withInflight("handleHead", handleHead(p, fss))))
+	r.Post(fileRoute, requireCapability(p, CapWrite, withInflight("handleCreate", handleCreate(p, fss))))
+	r.Put(fileRoute, requireCapability(p, CapWrite, withInflight("handlePutPart", handlePutPart(p, fss))))
+	// pat matches routes by prefix in registration order, so /keys/{id}
+	// must come before the file route that would otherwise capture it.
+	r.Delete("/keys/{id}", requireCapability(p, CapAdmin, withInflight("handleKeyDelete", handleKeyDelete(p))))
+	r.Delete(fileRoute, requireCapability(p, CapDelete, withInflight("handleDelete", handleDelete(p, fss))))
+	r.Post("/keys", requireCapability(p, CapAdmin, withInflight("handleKeyCreate", handleKeyCreate(p))))
+	r.Get("/", requireCapability(p, CapList, withInflight("handleBucketList", handleBucketList(p))))
+
+	d := pat.New()
+	d.Get("/metrics", func(w http.ResponseWriter, r *http.Request) { promhttp.Handler().ServeHTTP(w, r) })
+	d.Get("/healthz", handleHealthz())
+	d.Get("/readyz", handleReadyz(p, fss))
+
+	go func() { log.Fatal(http.ListenAndServe(*debugAddress, http.Handler(d))) }()
 	log.Fatal(http.ListenAndServe(*httpAddress, http.Handler(r)))
 }
 
-func handleCreate(p Provider, fs FileSystem) http.HandlerFunc {
+// backendSet lazily constructs and caches one FileSystem per backend name,
+// so that buckets whose Policy.Backend differs from the default aren't
+// paying for a client they never use.
+type backendSet struct {
+	def string
+	cfg fs.Config
+	fss map[string]fs.FileSystem
+}
+
+func newBackendSet(def string, cfg fs.Config) *backendSet {
+	return &backendSet{def: def, cfg: cfg, fss: map[string]fs.FileSystem{}}
+}
+
+func (s *backendSet) forBucket(b *Bucket) (fs.FileSystem, error) {
+	name := s.def
+	if b.Policy != nil && b.Policy.Backend != "" {
+		name = b.Policy.Backend
+	}
+
+	if f, ok := s.fss[name]; ok {
+		return f, nil
+	}
+
+	f, err := fs.New(name, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.fss[name] = f
+
+	return f, nil
+}
+
+// requestContext derives a context from r bounded by -http.request-timeout,
+// when configured, so a client disconnect or a deadline propagates into
+// the FileSystem call instead of letting it run to completion on its own.
+func requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if requestTimeout <= 0 {
+		return r.Context(), func() {}
+	}
+	return context.WithTimeout(r.Context(), requestTimeout)
+}
+
+// trackCancellation records ent_requests_cancelled_total when err is the
+// context error that aborted op.
+func trackCancellation(err error, op string) {
+	switch err {
+	case context.DeadlineExceeded, context.Canceled:
+		requestsCancelled.WithLabelValues(op).Inc()
+	}
+}
+
+func handleCreate(p Provider, fss *backendSet) http.HandlerFunc {
+	upload := handleUploadCreate()
+	finalize := handleUploadFinalize(p, fss)
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Query().Get("uploads") == "1":
+			upload(w, r)
+			return
+		case r.URL.Query().Get("finalize") == "1":
+			finalize(w, r)
+			return
+		}
+
 		var (
 			began  = time.Now()
 			bucket = r.URL.Query().Get(":bucket")
 			key    = r.URL.Query().Get(":key")
+			b      *Bucket
+			rd     *ReaderDelegator
 		)
 		defer r.Body.Close()
 
-		b, err := p.Get(bucket)
+		ctx, cancel := requestContext(r)
+		defer cancel()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() { reportMetrics(rec, r, rd, b, began, "handleCreate") }()
+
+		var err error
+		b, err = p.Get(bucket)
 		if err != nil {
-			respondError(w, r.Method, r.URL.String(), err)
+			respondError(rec, r.Method, r.URL.String(), err)
 			return
 		}
 
-		rd := NewReaderDelegator(r.Body)
-		f, err := fs.Create(b, key, rd)
+		bfs, err := fss.forBucket(b)
 		if err != nil {
-			respondError(w, r.Method, r.URL.String(), err)
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		rd = NewReaderDelegator(r.Body)
+		f, err := bfs.Create(ctx, b.Name, key, rd)
+		if err != nil {
+			trackCancellation(err, "handleCreate")
+			respondError(rec, r.Method, r.URL.String(), err)
 			return
 		}
 		h, err := f.Hash()
 		if err != nil {
-			respondError(w, r.Method, r.URL.String(), err)
+			respondError(rec, r.Method, r.URL.String(), err)
 			return
 		}
 
-		rwd := exp.NewResponseWriterDelegator(w)
-		defer reportMetrics(rwd, r, rd, b, began, "handleCreate")
+		if expected := r.Header.Get("X-Ent-Expected-SHA1"); expected != "" && !strings.EqualFold(hex.EncodeToString(h), expected) {
+			bfs.Delete(ctx, b.Name, key)
+			respondError(rec, r.Method, r.URL.String(), ErrHashMismatch)
+			return
+		}
 
-		respondCreated(rwd, b, key, h, began)
+		respondCreated(rec, b, key, h, began)
 	}
 }
 
-func handleGet(p Provider, fs FileSystem) http.HandlerFunc {
+func handleGet(p Provider, fss *backendSet) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var (
 			began  = time.Now()
 			bucket = r.URL.Query().Get(":bucket")
 			key    = r.URL.Query().Get(":key")
+			b      *Bucket
 		)
 
-		b, err := p.Get(bucket)
+		ctx, cancel := requestContext(r)
+		defer cancel()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() { reportMetrics(rec, r, nil, b, began, "handleGet") }()
+
+		var err error
+		b, err = p.Get(bucket)
 		if err != nil {
-			respondError(w, r.Method, r.URL.String(), err)
+			respondError(rec, r.Method, r.URL.String(), err)
 			return
 		}
 
-		f, err := fs.Open(b, key)
+		bfs, err := fss.forBucket(b)
 		if err != nil {
-			respondError(w, r.Method, r.URL.String(), err)
+			respondError(rec, r.Method, r.URL.String(), err)
 			return
 		}
 
-		rwd := exp.NewResponseWriterDelegator(w)
-		defer reportMetrics(rwd, r, nil, b, began, "handleGet")
+		f, err := bfs.Open(ctx, b.Name, key)
+		if err != nil {
+			trackCancellation(err, "handleGet")
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
 
-		http.ServeContent(rwd, r, key, time.Now(), f)
+		// f is an io.ReadSeeker, so ServeContent already honors Range and
+		// conditional request headers without any extra wrapping.
+		http.ServeContent(rec, r, key, time.Now(), f)
+	}
+}
+
+// handleHead answers HEAD requests from FileSystem.Stat alone, without
+// opening the object's body.
+func handleHead(p Provider, fss *backendSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			began  = time.Now()
+			bucket = r.URL.Query().Get(":bucket")
+			key    = r.URL.Query().Get(":key")
+			b      *Bucket
+		)
+
+		ctx, cancel := requestContext(r)
+		defer cancel()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() { reportMetrics(rec, r, nil, b, began, "handleHead") }()
+
+		var err error
+		b, err = p.Get(bucket)
+		if err != nil {
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		bfs, err := fss.forBucket(b)
+		if err != nil {
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		info, err := bfs.Stat(ctx, b.Name, key)
+		if err != nil {
+			trackCancellation(err, "handleHead")
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		rec.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		if len(info.SHA1) > 0 {
+			rec.Header().Set("ETag", `"`+hex.EncodeToString(info.SHA1)+`"`)
+		}
+		rec.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+		rec.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleDelete removes the object at :bucket/:key, answering with
+// StatusNoContent on success. It is the only route CapDelete authorizes.
+func handleDelete(p Provider, fss *backendSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			began  = time.Now()
+			bucket = r.URL.Query().Get(":bucket")
+			key    = r.URL.Query().Get(":key")
+			b      *Bucket
+		)
+
+		ctx, cancel := requestContext(r)
+		defer cancel()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() { reportMetrics(rec, r, nil, b, began, "handleDelete") }()
+
+		var err error
+		b, err = p.Get(bucket)
+		if err != nil {
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		bfs, err := fss.forBucket(b)
+		if err != nil {
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		if err := bfs.Delete(ctx, b.Name, key); err != nil {
+			trackCancellation(err, "handleDelete")
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		rec.WriteHeader(http.StatusNoContent)
 	}
 }
 
@@ -130,16 +360,16 @@ func handleBucketList(p Provider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		began := time.Now()
 
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() { reportMetrics(rec, r, nil, nil, began, "handleBucketList") }()
+
 		bs, err := p.List()
 		if err != nil {
-			respondError(w, r.Method, r.URL.String(), err)
+			respondError(rec, r.Method, r.URL.String(), err)
 			return
 		}
 
-		rwd := exp.NewResponseWriterDelegator(w)
-		defer reportMetrics(rwd, r, nil, nil, began, "handleBucketList")
-
-		respondBucketList(rwd, bs, began)
+		respondBucketList(rec, bs, began)
 	}
 }
 
@@ -201,8 +431,18 @@ func respondError(w http.ResponseWriter, method, url string, err error) {
 	code := http.StatusInternalServerError
 
 	switch err {
-	case ErrBucketNotFound, ErrFileNotFound:
+	case ErrBucketNotFound, ErrFileNotFound, fs.ErrNotFound, ErrKeyNotFound:
 		code = http.StatusNotFound
+	case ErrUnauthorized:
+		code = http.StatusUnauthorized
+	case ErrForbidden:
+		code = http.StatusForbidden
+	case ErrHashMismatch:
+		code = http.StatusUnprocessableEntity
+	case context.DeadlineExceeded:
+		code = http.StatusGatewayTimeout
+	case context.Canceled:
+		code = 499 // client closed request, as popularized by nginx
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -259,32 +499,43 @@ type responseFileWrapper struct {
 }
 
 func reportMetrics(
-	rwd *exp.ResponseWriterDelegator,
+	rec *statusRecorder,
 	r *http.Request,
 	rd *ReaderDelegator,
 	b *Bucket,
 	began time.Time,
 	op string,
 ) {
-	d := float64(time.Since(began))
-	labels := map[string]string{
-		"method":    strings.ToLower(r.Method),
-		"operation": op,
-		"status":    rwd.Status(),
-	}
+	d := time.Since(began).Seconds()
 
+	bucket := ""
 	if b != nil {
-		labels["bucket"] = b.Name
+		bucket = bucketLabel(b.Name)
 	}
 
-	if rd != nil {
-		requestBytes.IncrementBy(labels, float64(rd.BytesRead))
+	keyID := ""
+	if id := keyIDFromContext(r.Context()); id != "" {
+		if keyIDAllowlist[id] {
+			keyID = id
+		} else {
+			keyID = "other"
+		}
 	}
 
-	requestTotal.Increment(labels)
-	requestDuration.IncrementBy(labels, d)
-	requestDurations.Add(labels, d)
-	responseBytes.IncrementBy(labels, float64(rwd.BytesWritten))
+	status := rec.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	labels := []string{strings.ToLower(r.Method), op, strconv.Itoa(status), bucket, keyID}
+
+	requestsTotal.WithLabelValues(labels...).Inc()
+	requestDurationSeconds.WithLabelValues(labels...).Observe(d)
+	downloadBytes.WithLabelValues(labels...).Observe(float64(rec.bytesWritten))
+
+	if rd != nil {
+		uploadBytes.WithLabelValues(labels...).Observe(float64(rd.BytesRead))
+	}
 }
 
 type ReaderDelegator struct {
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleHead(t *testing.T) {
+	p, fss, _ := newTestFixture(t)
+
+	bfs, err := fss.forBucket(p.bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Create(context.Background(), "photos", "a.jpg", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("HEAD", "/photos/a.jpg?:bucket=photos&:key=a.jpg", nil)
+	w := httptest.NewRecorder()
+
+	handleHead(p, fss)(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Length"); got != "5" {
+		t.Errorf("Content-Length = %q, want %q", got, "5")
+	}
+	if w.Header().Get("ETag") == "" {
+		t.Error("expected an ETag header to be set")
+	}
+	if w.Header().Get("Last-Modified") == "" {
+		t.Error("expected a Last-Modified header to be set")
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("HEAD response should have no body, got %d bytes", w.Body.Len())
+	}
+}
+
+func TestHandleHeadNotFound(t *testing.T) {
+	p, fss, _ := newTestFixture(t)
+
+	r := httptest.NewRequest("HEAD", "/photos/missing.jpg?:bucket=photos&:key=missing.jpg", nil)
+	w := httptest.NewRecorder()
+
+	handleHead(p, fss)(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandleGetRange(t *testing.T) {
+	p, fss, _ := newTestFixture(t)
+
+	bfs, err := fss.forBucket(p.bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Create(context.Background(), "photos", "a.txt", strings.NewReader("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/photos/a.txt?:bucket=photos&:key=a.txt", nil)
+	r.Header.Set("Range", "bytes=2-4")
+	w := httptest.NewRecorder()
+
+	handleGet(p, fss)(w, r)
+
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusPartialContent)
+	}
+	if got := w.Body.String(); got != "234" {
+		t.Errorf("range body = %q, want %q", got, "234")
+	}
+}
+
+func TestHandleGetFullBody(t *testing.T) {
+	p, fss, _ := newTestFixture(t)
+
+	bfs, err := fss.forBucket(p.bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Create(context.Background(), "photos", "a.txt", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/photos/a.txt?:bucket=photos&:key=a.txt", nil)
+	w := httptest.NewRecorder()
+
+	handleGet(p, fss)(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Body.String(); got != "hello" {
+		t.Errorf("body = %q, want %q", got, "hello")
+	}
+}
+
+func TestHandleDelete(t *testing.T) {
+	p, fss, _ := newTestFixture(t)
+
+	bfs, err := fss.forBucket(p.bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bfs.Create(context.Background(), "photos", "a.jpg", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("DELETE", "/photos/a.jpg?:bucket=photos&:key=a.jpg", nil)
+	w := httptest.NewRecorder()
+
+	handleDelete(p, fss)(w, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	if _, err := bfs.Open(context.Background(), "photos", "a.jpg"); err == nil {
+		t.Error("object should be gone after handleDelete")
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	old := requestTimeout
+	defer func() { requestTimeout = old }()
+
+	r := httptest.NewRequest("GET", "/", nil)
+
+	requestTimeout = 0
+	ctx, cancel := requestContext(r)
+	cancel()
+	if ctx != r.Context() {
+		t.Error("requestContext with no configured timeout should return the request's own context unchanged")
+	}
+
+	requestTimeout = time.Hour
+	ctx2, cancel2 := requestContext(r)
+	defer cancel2()
+	if _, ok := ctx2.Deadline(); !ok {
+		t.Error("requestContext with a positive timeout should set a deadline on the returned context")
+	}
+}
+
+func TestTrackCancellation(t *testing.T) {
+	const op = "test-handle-cancellation"
+
+	before := counterValue(t, requestsCancelled.WithLabelValues(op))
+	trackCancellation(context.DeadlineExceeded, op)
+	if got := counterValue(t, requestsCancelled.WithLabelValues(op)); got != before+1 {
+		t.Errorf("requestsCancelled after DeadlineExceeded = %v, want %v", got, before+1)
+	}
+
+	trackCancellation(context.Canceled, op)
+	if got := counterValue(t, requestsCancelled.WithLabelValues(op)); got != before+2 {
+		t.Errorf("requestsCancelled after Canceled = %v, want %v", got, before+2)
+	}
+
+	trackCancellation(ErrFileNotFound, op)
+	if got := counterValue(t, requestsCancelled.WithLabelValues(op)); got != before+2 {
+		t.Errorf("requestsCancelled should not increment on a non-context error, got %v", got)
+	}
+}
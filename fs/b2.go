@@ -0,0 +1,165 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/kurin/blazer/b2"
+	"golang.org/x/net/context"
+)
+
+// B2Config configures a B2 FileSystem. Bucket/key map onto B2's
+// bucket/object.
+type B2Config struct {
+	AccountID      string
+	ApplicationKey string
+}
+
+// B2 is a FileSystem backed by Backblaze B2.
+type B2 struct {
+	client *b2.Client
+	ctx    context.Context
+	stager *stager
+}
+
+// NewB2 returns a B2 FileSystem configured from cfg.
+func NewB2(cfg B2Config) (*B2, error) {
+	ctx := context.Background()
+
+	c, err := b2.NewClient(ctx, cfg.AccountID, cfg.ApplicationKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &B2{client: c, ctx: ctx, stager: newStager(os.TempDir())}, nil
+}
+
+// CreatePart stages one chunk of a large-file upload locally. B2 already
+// has a native large-file API that ent's own HTTP surface mirrors, but
+// driving it requires an upload-part URL/auth-token dance per part that
+// doesn't fit the synchronous CreatePart/Finalize split here, so parts are
+// staged the same way as on every other backend and uploaded whole on
+// Finalize.
+func (b *B2) CreatePart(ctx context.Context, bucket, key, uploadID string, part int, r io.Reader) ([]byte, error) {
+	return b.stager.createPart(ctx, uploadID, part, r)
+}
+
+// Finalize assembles the parts staged under uploadID and uploads the
+// result as object key in bucket, streaming tmp straight into the object
+// writer instead of going through Create, which would buffer the whole
+// object into memory first — exactly what a multi-GB upload can't afford.
+func (b *B2) Finalize(ctx context.Context, bucket, key, uploadID string, parts []Part) (File, error) {
+	tmp, sum, err := b.stager.assemble(ctx, uploadID, parts)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	bk, err := b.bucket(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bk.Object(key).NewWriter(ctx)
+	if _, err := io.Copy(w, newCtxReader(ctx, tmp)); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &writtenFile{hash: sum}, nil
+}
+
+// DeletePart removes the staged part uploadID/part, e.g. after it failed
+// its SHA1 check.
+func (b *B2) DeletePart(ctx context.Context, bucket, key, uploadID string, part int) error {
+	return b.stager.removePart(uploadID, part)
+}
+
+func (b *B2) bucket(ctx context.Context, name string) (*b2.Bucket, error) {
+	return b.client.Bucket(ctx, name)
+}
+
+// Create uploads r to object key in bucket.
+func (b *B2) Create(ctx context.Context, bucket, key string, r io.Reader) (File, error) {
+	h := sha1.New()
+	buf, err := ioutil.ReadAll(io.TeeReader(newCtxReader(ctx, r), h))
+	if err != nil {
+		return nil, err
+	}
+
+	bk, err := b.bucket(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bk.Object(key).NewWriter(ctx)
+	if _, err := w.Write(buf); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &memFile{Reader: bytes.NewReader(buf), hash: h.Sum(nil)}, nil
+}
+
+// Open fetches object key from bucket.
+func (b *B2) Open(ctx context.Context, bucket, key string) (File, error) {
+	bk, err := b.bucket(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bk.Object(key).NewReader(ctx)
+	defer r.Close()
+
+	buf, err := ioutil.ReadAll(r)
+	if err == b2.ErrNotExist {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &memFile{Reader: bytes.NewReader(buf)}, nil
+}
+
+// Delete removes object key from bucket.
+func (b *B2) Delete(ctx context.Context, bucket, key string) error {
+	bk, err := b.bucket(ctx, bucket)
+	if err != nil {
+		return err
+	}
+
+	err = bk.Object(key).Delete(ctx)
+	if err == b2.ErrNotExist {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Stat returns the Info of object key in bucket.
+func (b *B2) Stat(ctx context.Context, bucket, key string) (*Info, error) {
+	bk, err := b.bucket(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := bk.Object(key).Attrs(ctx)
+	if err == b2.ErrNotExist {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Info{Size: attrs.Size, ModTime: attrs.UploadTimestamp}, nil
+}
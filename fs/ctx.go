@@ -0,0 +1,25 @@
+package fs
+
+import (
+	"context"
+	"io"
+)
+
+// ctxReader aborts a Read with ctx.Err() as soon as ctx is done, so a
+// cancelled request stops a streaming copy instead of running it to
+// completion.
+type ctxReader struct {
+	ctx context.Context
+	io.Reader
+}
+
+func newCtxReader(ctx context.Context, r io.Reader) io.Reader {
+	return &ctxReader{ctx: ctx, Reader: r}
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(p)
+}
@@ -0,0 +1,182 @@
+package fs
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DiskConfig configures a Disk FileSystem.
+type DiskConfig struct {
+	Root string
+}
+
+// Disk is a FileSystem that stores every bucket as a directory under Root
+// and every key as a file within it.
+type Disk struct {
+	root   string
+	stager *stager
+}
+
+// NewDisk returns a Disk FileSystem rooted at root.
+func NewDisk(root string) *Disk {
+	return &Disk{root: root, stager: newStager(root)}
+}
+
+// CreatePart stages one chunk of a large-file upload under
+// root/uploads/{uploadID}/{part}.
+func (d *Disk) CreatePart(ctx context.Context, bucket, key, uploadID string, part int, r io.Reader) ([]byte, error) {
+	return d.stager.createPart(ctx, uploadID, part, r)
+}
+
+// Finalize assembles the parts staged under uploadID into bucket/key.
+func (d *Disk) Finalize(ctx context.Context, bucket, key, uploadID string, parts []Part) (File, error) {
+	tmp, _, err := d.stager.assemble(ctx, uploadID, parts)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	return d.Create(ctx, bucket, key, tmp)
+}
+
+// DeletePart removes the staged part uploadID/part, e.g. after it failed
+// its SHA1 check.
+func (d *Disk) DeletePart(ctx context.Context, bucket, key, uploadID string, part int) error {
+	return d.stager.removePart(uploadID, part)
+}
+
+func (d *Disk) path(bucket, key string) string {
+	return filepath.Join(d.root, bucket, key)
+}
+
+func (d *Disk) sha1Path(bucket, key string) string {
+	return d.path(bucket, key) + ".sha1"
+}
+
+// Create writes r to bucket/key, creating any intermediate directories as
+// needed, and returns a File positioned at the start of the written
+// contents. r is written to a sibling temp file first and renamed into
+// place only once it's been written in full, so an aborted write (a
+// cancelled ctx, a client disconnect, a caller that rejects the result
+// after the fact) can never leave a truncated object sitting at bucket/key.
+// The computed SHA1 is cached in a sidecar file so a later Stat can report
+// it without re-reading the whole object.
+func (d *Disk) Create(ctx context.Context, bucket, key string, r io.Reader) (File, error) {
+	p := d.path(bucket, key)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(p), ".ent-tmp-")
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha1.New()
+	if _, err := io.Copy(tmp, io.TeeReader(newCtxReader(ctx, r), h)); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	if _, err := tmp.Seek(0, os.SEEK_SET); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+
+	sum := h.Sum(nil)
+	ioutil.WriteFile(d.sha1Path(bucket, key), []byte(hex.EncodeToString(sum)), 0644)
+
+	return &diskFile{File: tmp, hash: sum}, nil
+}
+
+// Open returns the File stored at bucket/key, or ErrNotFound if it does not
+// exist.
+func (d *Disk) Open(ctx context.Context, bucket, key string) (File, error) {
+	f, err := os.Open(d.path(bucket, key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &diskFile{File: f}, nil
+}
+
+// Delete removes the file stored at bucket/key and its cached hash
+// sidecar, if any.
+func (d *Disk) Delete(ctx context.Context, bucket, key string) error {
+	err := os.Remove(d.path(bucket, key))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	os.Remove(d.sha1Path(bucket, key))
+	return err
+}
+
+// Stat returns the Info of the file stored at bucket/key, including its
+// SHA1 when a cached sidecar is available.
+func (d *Disk) Stat(ctx context.Context, bucket, key string) (*Info, error) {
+	fi, err := os.Stat(d.path(bucket, key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{Size: fi.Size(), ModTime: fi.ModTime()}
+	if buf, err := ioutil.ReadFile(d.sha1Path(bucket, key)); err == nil {
+		if sum, err := hex.DecodeString(string(buf)); err == nil {
+			info.SHA1 = sum
+		}
+	}
+
+	return info, nil
+}
+
+// diskFile adapts an *os.File into a File, optionally carrying a
+// pre-computed hash for files that were just written by Create.
+type diskFile struct {
+	*os.File
+	hash []byte
+}
+
+// Hash returns the SHA1 of the file's contents, computing it by reading the
+// whole file if it was not already known (i.e. the file was opened rather
+// than just created).
+func (f *diskFile) Hash() ([]byte, error) {
+	if f.hash != nil {
+		return f.hash, nil
+	}
+
+	off, err := f.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+
+	h := sha1.New()
+	if _, err := io.Copy(h, f.File); err != nil {
+		return nil, err
+	}
+	f.hash = h.Sum(nil)
+
+	_, err = f.Seek(off, os.SEEK_SET)
+	return f.hash, err
+}
@@ -0,0 +1,141 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiskCreateOpenStatDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ent-disk-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDisk(dir)
+
+	f, err := d.Create(context.Background(), "photos", "a.jpg", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	h, err := f.Hash()
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	f.Close()
+
+	info, err := d.Stat(context.Background(), "photos", "a.jpg")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != 5 {
+		t.Errorf("Stat.Size = %d, want 5", info.Size)
+	}
+	if string(info.SHA1) != string(h) {
+		t.Errorf("Stat.SHA1 = %x, want %x", info.SHA1, h)
+	}
+
+	rf, err := d.Open(context.Background(), "photos", "a.jpg")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rf.Close()
+
+	got, err := ioutil.ReadAll(rf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("Open content = %q, want %q", got, "hello")
+	}
+
+	if err := d.Delete(context.Background(), "photos", "a.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := d.Open(context.Background(), "photos", "a.jpg"); err != ErrNotFound {
+		t.Errorf("Open after Delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDiskOpenNotFound(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ent-disk-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDisk(dir)
+	if _, err := d.Open(context.Background(), "photos", "does-not-exist"); err != ErrNotFound {
+		t.Errorf("Open of a missing key = %v, want ErrNotFound", err)
+	}
+}
+
+// errReader fails with err after yielding buf, to exercise Create's cleanup path
+// on an aborted write.
+type errReader struct {
+	buf []byte
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func TestDiskCreateLeavesNoPartialFileOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ent-disk-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDisk(dir)
+
+	// Seed an existing object, then attempt to overwrite it with a write
+	// that fails partway through: the original bytes must survive, and no
+	// temp file should be left behind.
+	if _, err := d.Create(context.Background(), "photos", "a.jpg", strings.NewReader("original")); err != nil {
+		t.Fatalf("seed Create: %v", err)
+	}
+
+	_, err = d.Create(context.Background(), "photos", "a.jpg", &errReader{
+		buf: []byte("truncated"),
+		err: errors.New("boom"),
+	})
+	if err == nil {
+		t.Fatal("Create with a failing reader should have returned an error")
+	}
+
+	rf, err := d.Open(context.Background(), "photos", "a.jpg")
+	if err != nil {
+		t.Fatalf("Open after failed Create: %v", err)
+	}
+	defer rf.Close()
+
+	got, err := ioutil.ReadAll(rf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "original" {
+		t.Errorf("content after a failed overwrite = %q, want the original %q", got, "original")
+	}
+
+	fis, err := ioutil.ReadDir(filepath.Join(dir, "photos"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range fis {
+		if strings.HasPrefix(fi.Name(), ".ent-tmp-") {
+			t.Errorf("leftover temp file %q after a failed Create", fi.Name())
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2014, SoundCloud Ltd.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/ent
+
+// Package fs provides the FileSystem abstraction ent uses to store and
+// retrieve bucket contents, together with its concrete backend
+// implementations (disk, Swift, GCS, S3 and B2).
+package fs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned by Open, Stat and Delete when the requested key
+// does not exist on the backend.
+var ErrNotFound = errors.New("file not found")
+
+// Part identifies one chunk of a large-file upload by its 1-based number
+// and the SHA1 it was uploaded with, as supplied to Finalize.
+type Part struct {
+	Number int
+	SHA1   []byte
+}
+
+// File is a handle to a single object read back from a FileSystem.
+type File interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+
+	// Hash returns the SHA1 of the file's contents.
+	Hash() ([]byte, error)
+}
+
+// Info describes the metadata of a stored object, independent of the
+// backend that holds it. SHA1 is populated when the backend tracks a
+// content hash for the object; a nil value means it is unknown without
+// opening the object.
+type Info struct {
+	Size    int64
+	ModTime time.Time
+	SHA1    []byte
+}
+
+// FileSystem is implemented by every ent storage backend. bucket is the
+// backend-specific name of the container the key lives under (for disk this
+// is a directory, for the cloud backends it is the bucket/container name).
+// Every method takes a context so a client disconnect or a
+// -http.request-timeout deadline can abort an in-flight transfer instead
+// of holding the backend connection open until it completes on its own.
+type FileSystem interface {
+	Create(ctx context.Context, bucket, key string, r io.Reader) (File, error)
+	Open(ctx context.Context, bucket, key string) (File, error)
+	Delete(ctx context.Context, bucket, key string) error
+	Stat(ctx context.Context, bucket, key string) (*Info, error)
+
+	// CreatePart stages one chunk of a large-file upload identified by
+	// uploadID and returns the SHA1 it computed over r, for the caller to
+	// verify.
+	CreatePart(ctx context.Context, bucket, key, uploadID string, part int, r io.Reader) ([]byte, error)
+
+	// DeletePart removes a previously staged part, e.g. one the caller
+	// rejected for failing its SHA1 check, so it isn't left behind until
+	// the whole upload is eventually abandoned.
+	DeletePart(ctx context.Context, bucket, key, uploadID string, part int) error
+
+	// Finalize assembles the parts staged under uploadID, in the order
+	// given, into the file at bucket/key, verifying each part's SHA1
+	// along the way.
+	Finalize(ctx context.Context, bucket, key, uploadID string, parts []Part) (File, error)
+}
+
+// New returns the FileSystem registered under backend, configured from cfg.
+func New(backend string, cfg Config) (FileSystem, error) {
+	switch backend {
+	case "", "disk":
+		return NewDisk(cfg.Disk.Root), nil
+	case "swift":
+		return NewSwift(cfg.Swift)
+	case "gcs":
+		return NewGCS(cfg.GCS)
+	case "s3":
+		return NewS3(cfg.S3)
+	case "b2":
+		return NewB2(cfg.B2)
+	default:
+		return nil, errors.New("fs: unknown backend " + backend)
+	}
+}
+
+// Config bundles the per-backend configuration used by New. Only the
+// fields of the selected backend are read.
+type Config struct {
+	Disk  DiskConfig
+	Swift SwiftConfig
+	GCS   GCSConfig
+	S3    S3Config
+	B2    B2Config
+}
@@ -0,0 +1,142 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+)
+
+// GCSConfig configures a GCS FileSystem. Endpoint overrides the default
+// storage.googleapis.com host and is used to point at a fake-gcs-server
+// instance in tests.
+type GCSConfig struct {
+	ProjectID string
+	Endpoint  string
+}
+
+// GCS is a FileSystem backed by Google Cloud Storage. Bucket/key map onto
+// GCS's bucket/object.
+type GCS struct {
+	client *storage.Client
+	ctx    context.Context
+	stager *stager
+}
+
+// NewGCS returns a GCS FileSystem configured from cfg.
+func NewGCS(cfg GCSConfig) (*GCS, error) {
+	ctx := context.Background()
+
+	var opts []option.ClientOption
+	if cfg.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.Endpoint))
+	}
+
+	c, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GCS{client: c, ctx: ctx, stager: newStager(os.TempDir())}, nil
+}
+
+// CreatePart stages one chunk of a large-file upload locally.
+func (g *GCS) CreatePart(ctx context.Context, bucket, key, uploadID string, part int, r io.Reader) ([]byte, error) {
+	return g.stager.createPart(ctx, uploadID, part, r)
+}
+
+// Finalize assembles the parts staged under uploadID and uploads the
+// result as object key in bucket, streaming tmp straight into the object
+// writer instead of going through Create, which would buffer the whole
+// object into memory first — exactly what a multi-GB upload can't afford.
+func (g *GCS) Finalize(ctx context.Context, bucket, key, uploadID string, parts []Part) (File, error) {
+	tmp, sum, err := g.stager.assemble(ctx, uploadID, parts)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := g.client.Bucket(bucket).Object(key).NewWriter(ctx)
+	if _, err := io.Copy(w, newCtxReader(ctx, tmp)); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &writtenFile{hash: sum}, nil
+}
+
+// DeletePart removes the staged part uploadID/part, e.g. after it failed
+// its SHA1 check.
+func (g *GCS) DeletePart(ctx context.Context, bucket, key, uploadID string, part int) error {
+	return g.stager.removePart(uploadID, part)
+}
+
+// Create uploads r to object key in bucket.
+func (g *GCS) Create(ctx context.Context, bucket, key string, r io.Reader) (File, error) {
+	h := sha1.New()
+	buf, err := ioutil.ReadAll(io.TeeReader(newCtxReader(ctx, r), h))
+	if err != nil {
+		return nil, err
+	}
+
+	w := g.client.Bucket(bucket).Object(key).NewWriter(ctx)
+	if _, err := w.Write(buf); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &memFile{Reader: bytes.NewReader(buf), hash: h.Sum(nil)}, nil
+}
+
+// Open fetches object key from bucket.
+func (g *GCS) Open(ctx context.Context, bucket, key string) (File, error) {
+	r, err := g.client.Bucket(bucket).Object(key).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memFile{Reader: bytes.NewReader(buf)}, nil
+}
+
+// Delete removes object key from bucket.
+func (g *GCS) Delete(ctx context.Context, bucket, key string) error {
+	err := g.client.Bucket(bucket).Object(key).Delete(ctx)
+	if err == storage.ErrObjectNotExist {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Stat returns the Info of object key in bucket.
+func (g *GCS) Stat(ctx context.Context, bucket, key string) (*Info, error) {
+	attrs, err := g.client.Bucket(bucket).Object(key).Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Info{Size: attrs.Size, ModTime: attrs.Updated}, nil
+}
@@ -0,0 +1,57 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"io"
+)
+
+// memFile wraps a fully buffered object for backends whose client
+// libraries don't expose a seekable stream of their own (GCS, S3, B2,
+// Swift). hash is populated when the File was produced by a Create call
+// that has already seen every byte; it is computed lazily otherwise.
+type memFile struct {
+	*bytes.Reader
+	hash []byte
+}
+
+func (f *memFile) Hash() ([]byte, error) {
+	if f.hash != nil {
+		return f.hash, nil
+	}
+
+	off, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	h := sha1.New()
+	if _, err := io.Copy(h, f.Reader); err != nil {
+		return nil, err
+	}
+	f.hash = h.Sum(nil)
+
+	_, err = f.Seek(off, io.SeekStart)
+	return f.hash, err
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+// writtenFile is returned by a backend's Finalize once it has streamed the
+// assembled upload straight into its upload API without buffering the
+// object in memory. Its content isn't held anywhere ent can hand back, but
+// callers of Finalize only ever ask it for the hash they already verified
+// while assembling the parts.
+type writtenFile struct {
+	hash []byte
+}
+
+func (f *writtenFile) Read(p []byte) (int, error)              { return 0, io.EOF }
+func (f *writtenFile) Seek(o int64, whence int) (int64, error) { return 0, nil }
+func (f *writtenFile) Close() error                            { return nil }
+func (f *writtenFile) Hash() ([]byte, error)                   { return f.hash, nil }
@@ -0,0 +1,152 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Config configures an S3 FileSystem. Bucket/key map onto S3's
+// bucket/object.
+type S3Config struct {
+	Region string
+}
+
+// S3 is a FileSystem backed by Amazon S3.
+type S3 struct {
+	client *s3.S3
+	stager *stager
+}
+
+// NewS3 returns an S3 FileSystem configured from cfg.
+func NewS3(cfg S3Config) (*S3, error) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(cfg.Region)})
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3{client: s3.New(sess), stager: newStager(os.TempDir())}, nil
+}
+
+// CreatePart stages one chunk of a large-file upload locally.
+func (s *S3) CreatePart(ctx context.Context, bucket, key, uploadID string, part int, r io.Reader) ([]byte, error) {
+	return s.stager.createPart(ctx, uploadID, part, r)
+}
+
+// Finalize assembles the parts staged under uploadID and uploads the
+// result as object key in bucket. tmp is a regular file, so it's handed to
+// PutObject directly as its io.ReadSeeker body instead of going through
+// Create, which would buffer the whole object into memory first — exactly
+// what a multi-GB upload can't afford.
+func (s *S3) Finalize(ctx context.Context, bucket, key, uploadID string, parts []Part) (File, error) {
+	tmp, sum, err := s.stager.assemble(ctx, uploadID, parts)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   tmp,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &writtenFile{hash: sum}, nil
+}
+
+// DeletePart removes the staged part uploadID/part, e.g. after it failed
+// its SHA1 check.
+func (s *S3) DeletePart(ctx context.Context, bucket, key, uploadID string, part int) error {
+	return s.stager.removePart(uploadID, part)
+}
+
+// Create uploads r to object key in bucket.
+func (s *S3) Create(ctx context.Context, bucket, key string, r io.Reader) (File, error) {
+	h := sha1.New()
+	buf, err := ioutil.ReadAll(io.TeeReader(newCtxReader(ctx, r), h))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(buf),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &memFile{Reader: bytes.NewReader(buf), hash: h.Sum(nil)}, nil
+}
+
+// Open fetches object key from bucket.
+func (s *S3) Open(ctx context.Context, bucket, key string) (File, error) {
+	out, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if isS3NotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	buf, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memFile{Reader: bytes.NewReader(buf)}, nil
+}
+
+// Delete removes object key from bucket.
+func (s *S3) Delete(ctx context.Context, bucket, key string) error {
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if isS3NotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Stat returns the Info of object key in bucket.
+func (s *S3) Stat(ctx context.Context, bucket, key string) (*Info, error) {
+	out, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if isS3NotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Info{Size: aws.Int64Value(out.ContentLength), ModTime: aws.TimeValue(out.LastModified)}, nil
+}
+
+func isS3NotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return true
+		}
+	}
+	return false
+}
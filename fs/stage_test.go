@@ -0,0 +1,97 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestStagerAssemble(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ent-stage-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newStager(dir)
+	const uploadID = "upload-1"
+
+	chunks := [][]byte{[]byte("hello, "), []byte("world")}
+	var parts []Part
+	for i, c := range chunks {
+		sum, err := s.createPart(context.Background(), uploadID, i+1, bytes.NewReader(c))
+		if err != nil {
+			t.Fatalf("createPart(%d): %v", i+1, err)
+		}
+		parts = append(parts, Part{Number: i + 1, SHA1: sum})
+	}
+
+	tmp, sum, err := s.assemble(context.Background(), uploadID, parts)
+	if err != nil {
+		t.Fatalf("assemble: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	got, err := ioutil.ReadAll(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "hello, world"; string(got) != want {
+		t.Errorf("assembled content = %q, want %q", got, want)
+	}
+
+	want := sha1.Sum(got)
+	if string(sum) != string(want[:]) {
+		t.Errorf("assemble returned SHA1 %x, want %x", sum, want)
+	}
+
+	if _, err := os.Stat(s.partPath(uploadID, 1)); !os.IsNotExist(err) {
+		t.Errorf("part 1 staging file should have been cleared, stat err = %v", err)
+	}
+}
+
+func TestStagerAssembleHashMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ent-stage-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newStager(dir)
+	const uploadID = "upload-2"
+
+	if _, err := s.createPart(context.Background(), uploadID, 1, bytes.NewReader([]byte("data"))); err != nil {
+		t.Fatalf("createPart: %v", err)
+	}
+
+	_, _, err = s.assemble(context.Background(), uploadID, []Part{{Number: 1, SHA1: []byte("not the right hash")}})
+	if err == nil {
+		t.Fatal("assemble with a mismatched part SHA1 should have failed")
+	}
+}
+
+func TestStagerRemovePart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ent-stage-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newStager(dir)
+	const uploadID = "upload-3"
+
+	if _, err := s.createPart(context.Background(), uploadID, 1, bytes.NewReader([]byte("data"))); err != nil {
+		t.Fatalf("createPart: %v", err)
+	}
+
+	if err := s.removePart(uploadID, 1); err != nil {
+		t.Fatalf("removePart: %v", err)
+	}
+	if _, err := os.Stat(s.partPath(uploadID, 1)); !os.IsNotExist(err) {
+		t.Errorf("expected part file to be gone, stat err = %v", err)
+	}
+}
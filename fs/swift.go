@@ -0,0 +1,158 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/ncw/swift"
+)
+
+// SwiftConfig configures a Swift FileSystem. Bucket/key map onto Swift's
+// container/object.
+type SwiftConfig struct {
+	UserName string
+	ApiKey   string
+	AuthUrl  string
+	Tenant   string
+}
+
+// Swift is a FileSystem backed by an OpenStack Swift object store.
+type Swift struct {
+	conn   *swift.Connection
+	stager *stager
+}
+
+// NewSwift authenticates against cfg and returns a Swift FileSystem.
+func NewSwift(cfg SwiftConfig) (*Swift, error) {
+	c := &swift.Connection{
+		UserName: cfg.UserName,
+		ApiKey:   cfg.ApiKey,
+		AuthUrl:  cfg.AuthUrl,
+		Tenant:   cfg.Tenant,
+	}
+	if err := c.Authenticate(); err != nil {
+		return nil, err
+	}
+
+	return &Swift{conn: c, stager: newStager(os.TempDir())}, nil
+}
+
+// CreatePart stages one chunk of a large-file upload locally.
+func (s *Swift) CreatePart(ctx context.Context, bucket, key, uploadID string, part int, r io.Reader) ([]byte, error) {
+	return s.stager.createPart(ctx, uploadID, part, r)
+}
+
+// Finalize assembles the parts staged under uploadID and uploads the
+// result as object key in container bucket, streaming tmp straight into
+// the object writer instead of going through Create, which would buffer
+// the whole object into memory first — exactly what a multi-GB upload
+// can't afford.
+func (s *Swift) Finalize(ctx context.Context, bucket, key, uploadID string, parts []Part) (File, error) {
+	tmp, sum, err := s.stager.assemble(ctx, uploadID, parts)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	w, err := s.conn.ObjectCreate(bucket, key, false, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, newCtxReader(ctx, tmp)); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &writtenFile{hash: sum}, nil
+}
+
+// DeletePart removes the staged part uploadID/part, e.g. after it failed
+// its SHA1 check.
+func (s *Swift) DeletePart(ctx context.Context, bucket, key, uploadID string, part int) error {
+	return s.stager.removePart(uploadID, part)
+}
+
+// Create uploads r to container bucket as object key. ncw/swift's
+// Connection takes no context, so cancellation only aborts the read of r
+// (via newCtxReader below) before the PUT begins; once ObjectCreate's
+// writer starts sending to Swift, a client disconnect or deadline no
+// longer stops it.
+func (s *Swift) Create(ctx context.Context, bucket, key string, r io.Reader) (File, error) {
+	h := sha1.New()
+	buf, err := ioutil.ReadAll(io.TeeReader(newCtxReader(ctx, r), h))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	w, err := s.conn.ObjectCreate(bucket, key, false, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(buf); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &memFile{Reader: bytes.NewReader(buf), hash: h.Sum(nil)}, nil
+}
+
+// Open fetches object key from container bucket. ncw/swift's
+// ObjectGetBytes takes no context, so a cancelled ctx is only checked
+// before the GET starts; once under way it runs to completion regardless
+// of a client disconnect or -http.request-timeout deadline.
+func (s *Swift) Open(ctx context.Context, bucket, key string) (File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	buf, err := s.conn.ObjectGetBytes(bucket, key)
+	if err == swift.ObjectNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &memFile{Reader: bytes.NewReader(buf)}, nil
+}
+
+// Delete removes object key from container bucket.
+func (s *Swift) Delete(ctx context.Context, bucket, key string) error {
+	err := s.conn.ObjectDelete(bucket, key)
+	if err == swift.ObjectNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Stat returns the Info of object key in container bucket.
+func (s *Swift) Stat(ctx context.Context, bucket, key string) (*Info, error) {
+	o, _, err := s.conn.Object(bucket, key)
+	if err == swift.ObjectNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Info{Size: o.Bytes, ModTime: o.LastModified}, nil
+}
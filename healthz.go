@@ -0,0 +1,56 @@
+// Copyright (c) 2014, SoundCloud Ltd.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/ent
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// healthzBucket is the bucket name ent writes a small probe object to
+// when answering /readyz. It isn't expected to carry a policy of its own;
+// handleReadyz talks to the default backend directly rather than going
+// through Provider.Get.
+const healthzBucket = "_healthz"
+
+func handleHealthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleReadyz reports whether ent can answer traffic: that its Provider
+// can list buckets, and that its default FileSystem backend can actually
+// take a write.
+func handleReadyz(p Provider, fss *backendSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := p.List(); err != nil {
+			respondError(w, r.Method, r.URL.String(), err)
+			return
+		}
+
+		bfs, err := fss.forBucket(&Bucket{Name: healthzBucket})
+		if err != nil {
+			respondError(w, r.Method, r.URL.String(), err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		key := "probe-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+		if _, err := bfs.Create(ctx, healthzBucket, key, strings.NewReader("ok")); err != nil {
+			respondError(w, r.Method, r.URL.String(), err)
+			return
+		}
+		defer bfs.Delete(ctx, healthzBucket, key)
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
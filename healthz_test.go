@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soundcloud/ent/fs"
+)
+
+func TestHandleHealthz(t *testing.T) {
+	r := httptest.NewRequest("GET", "/healthz", nil)
+	w := httptest.NewRecorder()
+
+	handleHealthz()(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestHandleReadyz(t *testing.T) {
+	p, fss, _ := newTestFixture(t)
+
+	r := httptest.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+
+	handleReadyz(p, fss)(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d, body = %s", w.Code, http.StatusOK, w.Body.String())
+	}
+}
+
+func TestHandleReadyzFailsWhenDefaultBackendCannotWrite(t *testing.T) {
+	p := &fakeProvider{bucket: &Bucket{Name: "photos", Policy: &Policy{Backend: "disk"}}}
+	// Point the default disk backend at a root that can't exist as a
+	// directory, so the probe write in handleReadyz fails.
+	fss := newBackendSet("disk", fs.Config{Disk: fs.DiskConfig{Root: "/dev/null/not-a-directory"}})
+
+	r := httptest.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+
+	handleReadyz(p, fss)(w, r)
+
+	if w.Code == http.StatusOK {
+		t.Error("handleReadyz should fail when the default backend can't take a write")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2014, SoundCloud Ltd.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/ent
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// requestLabels is the label set shared by every per-request metric, so
+// that ent_requests_total, ent_request_duration_seconds,
+// ent_upload_bytes and ent_download_bytes can all be sliced the same way
+// in Grafana.
+var requestLabels = []string{"method", "operation", "status", "bucket", "key_id"}
+
+// sloBuckets are the latency bucket boundaries, in seconds, used for
+// ent_request_duration_seconds.
+var sloBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ent_requests_total",
+		Help: "Total number of requests made.",
+	}, requestLabels)
+
+	requestDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ent_request_duration_seconds",
+		Help:    "Time ent has spent answering requests, in seconds.",
+		Buckets: sloBuckets,
+	}, requestLabels)
+
+	uploadBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ent_upload_bytes",
+		Help:    "Size distribution of request payloads accepted by ent.",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 12),
+	}, requestLabels)
+
+	downloadBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ent_download_bytes",
+		Help:    "Size distribution of response payloads served by ent.",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 12),
+	}, requestLabels)
+
+	requestsCancelled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ent_requests_cancelled_total",
+		Help: "Total number of requests whose context was cancelled or timed out before completion.",
+	}, []string{"operation"})
+
+	inflightRequests = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ent_inflight_requests",
+		Help: "Number of requests currently being handled.",
+	}, []string{"operation"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		requestsTotal,
+		requestDurationSeconds,
+		uploadBytes,
+		downloadBytes,
+		requestsCancelled,
+		inflightRequests,
+	)
+}
+
+// knownBuckets bounds the "bucket" label to buckets that actually have a
+// policy on record, so probing random bucket names can't grow metrics
+// cardinality without limit. Populated once at startup from Provider.List.
+var knownBuckets = map[string]bool{}
+
+func bucketLabel(name string) string {
+	if knownBuckets[name] {
+		return name
+	}
+	return ""
+}
+
+// statusRecorder wraps a ResponseWriter to capture the status code and
+// byte count written through it, replacing the old
+// prometheus/client_golang/prometheus/exp.ResponseWriterDelegator.
+type statusRecorder struct {
+	http.ResponseWriter
+	status       int
+	bytesWritten int64
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.bytesWritten += int64(n)
+	return n, err
+}
+
+// withInflight tracks ent_inflight_requests around next, labelled by op.
+func withInflight(op string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g := inflightRequests.WithLabelValues(op)
+		g.Inc()
+		defer g.Dec()
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// counterValue reads the current value of a prometheus.Counter directly,
+// without going through the /metrics text exposition format.
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+// gaugeValue reads the current value of a prometheus.Gauge directly.
+func gaugeValue(t *testing.T, g prometheus.Gauge) float64 {
+	t.Helper()
+
+	var m dto.Metric
+	if err := g.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func TestStatusRecorderDefaultsToOK(t *testing.T) {
+	rec := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+
+	if _, err := rec.Write([]byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.status != 200 {
+		t.Errorf("status = %d, want 200 when WriteHeader was never called", rec.status)
+	}
+	if rec.bytesWritten != 2 {
+		t.Errorf("bytesWritten = %d, want 2", rec.bytesWritten)
+	}
+}
+
+func TestStatusRecorderRecordsExplicitStatus(t *testing.T) {
+	rec := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+
+	rec.WriteHeader(404)
+	rec.WriteHeader(500) // only the first WriteHeader should stick
+
+	if rec.status != 404 {
+		t.Errorf("status = %d, want 404 (the first WriteHeader call)", rec.status)
+	}
+}
+
+func TestWithInflightTracksGauge(t *testing.T) {
+	const op = "test-inflight-op"
+
+	var during float64
+	h := withInflight(op, func(w http.ResponseWriter, r *http.Request) {
+		during = gaugeValue(t, inflightRequests.WithLabelValues(op))
+	})
+
+	before := gaugeValue(t, inflightRequests.WithLabelValues(op))
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	after := gaugeValue(t, inflightRequests.WithLabelValues(op))
+
+	if during != before+1 {
+		t.Errorf("gauge during the request = %v, want %v", during, before+1)
+	}
+	if after != before {
+		t.Errorf("gauge after the request returned = %v, want it back to %v", after, before)
+	}
+}
+
+func TestBucketLabel(t *testing.T) {
+	old := knownBuckets
+	defer func() { knownBuckets = old }()
+
+	knownBuckets = map[string]bool{"photos": true}
+
+	if got := bucketLabel("photos"); got != "photos" {
+		t.Errorf("bucketLabel(known) = %q, want %q", got, "photos")
+	}
+	if got := bucketLabel("unknown-bucket"); got != "" {
+		t.Errorf("bucketLabel(unknown) = %q, want empty string", got)
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2014, SoundCloud Ltd.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/ent
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrBucketNotFound is returned by a Provider when the requested
+	// bucket has no policy on record.
+	ErrBucketNotFound = errors.New("bucket not found")
+
+	// ErrFileNotFound reports a key that does not exist in the bucket. The
+	// FileSystem backends report that case as fs.ErrNotFound instead;
+	// respondError maps both to 404.
+	ErrFileNotFound = errors.New("file not found")
+
+	// ErrKeyNotFound is returned by a Provider when the requested
+	// application key does not exist.
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrUnauthorized is returned by AuthorizeKey when the key ID/secret
+	// pair does not authenticate.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrForbidden is returned by AuthorizeKey when the key authenticates
+	// but does not carry the requested capability, or is scoped to a
+	// different bucket or key prefix.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Capability names accepted in Key.Capabilities.
+const (
+	CapRead   = "read"
+	CapWrite  = "write"
+	CapList   = "list"
+	CapDelete = "delete"
+
+	// CapAdmin authorizes POST /keys and DELETE /keys/{id}. It is not
+	// scoped by BucketName/KeyPrefix the way the other capabilities are:
+	// minting or revoking a key is a server-wide operation, so only keys
+	// with no BucketName restriction should ever be granted it.
+	CapAdmin = "admin"
+)
+
+// Policy describes how a Bucket is configured, including which storage
+// backend its files live on.
+type Policy struct {
+	Backend string `json:"backend"`
+}
+
+// Bucket is the combination of a name and the Policy that governs it.
+type Bucket struct {
+	Name   string  `json:"name"`
+	Policy *Policy `json:"policy"`
+}
+
+// Key is a scoped application key, modelled after B2's application keys,
+// used to authenticate and authorize requests against the object and
+// bucket-list routes, as well as, when carrying CapAdmin, POST /keys and
+// DELETE /keys/{id} themselves.
+type Key struct {
+	KeyID        string    `json:"key_id"`
+	SecretHash   string    `json:"secret_hash"`
+	Capabilities []string  `json:"capabilities"`
+	BucketName   string    `json:"bucket_name,omitempty"`
+	KeyPrefix    string    `json:"key_prefix,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+}
+
+// expired reports whether the key is past its ExpiresAt, which is ignored
+// when zero.
+func (k *Key) expired() bool {
+	return !k.ExpiresAt.IsZero() && time.Now().After(k.ExpiresAt)
+}
+
+// allows reports whether the key grants cap on the given bucket/key.
+func (k *Key) allows(bucket, key, cap string) bool {
+	if k.BucketName != "" && k.BucketName != bucket {
+		return false
+	}
+	if k.KeyPrefix != "" && !strings.HasPrefix(key, k.KeyPrefix) {
+		return false
+	}
+
+	for _, c := range k.Capabilities {
+		if c == cap {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Provider resolves bucket names to their Bucket configuration and manages
+// the application keys used to authorize access to them.
+type Provider interface {
+	Get(name string) (*Bucket, error)
+	List() ([]*Bucket, error)
+
+	// CreateKey stores a new Key with the given scope and returns it
+	// together with the plaintext secret, which is never recoverable
+	// again once SecretHash has been persisted.
+	CreateKey(capabilities []string, bucketName, keyPrefix string, expiresAt time.Time) (*Key, string, error)
+
+	// DeleteKey removes the key identified by id.
+	DeleteKey(id string) error
+
+	// AuthorizeKey validates id/secret and checks that the resulting Key
+	// grants cap on bucket/key, returning ErrUnauthorized or ErrForbidden
+	// otherwise.
+	AuthorizeKey(id, secret, bucket, key, cap string) (*Key, error)
+}
+
+// DiskProvider is a Provider backed by a directory of per-bucket JSON
+// policy files, named "{bucket}.json".
+type DiskProvider struct {
+	dir string
+}
+
+// NewDiskProvider returns a DiskProvider that reads bucket policies from
+// dir.
+func NewDiskProvider(dir string) (*DiskProvider, error) {
+	return &DiskProvider{dir: dir}, nil
+}
+
+// Get returns the Bucket policy for name, or ErrBucketNotFound if no
+// policy file exists for it.
+func (p *DiskProvider) Get(name string) (*Bucket, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(p.dir, name+".json"))
+	if err != nil {
+		return nil, ErrBucketNotFound
+	}
+
+	var pol Policy
+	if err := json.Unmarshal(buf, &pol); err != nil {
+		return nil, err
+	}
+
+	return &Bucket{Name: name, Policy: &pol}, nil
+}
+
+// List returns every Bucket for which a policy file exists in the provider
+// directory.
+func (p *DiskProvider) List() ([]*Bucket, error) {
+	fis, err := ioutil.ReadDir(p.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var bs []*Bucket
+	for _, fi := range fis {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != ".json" {
+			continue
+		}
+
+		b, err := p.Get(strings.TrimSuffix(fi.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		bs = append(bs, b)
+	}
+
+	return bs, nil
+}
+
+// keysDir is the subdirectory of a DiskProvider's dir that holds key files,
+// one per key, named "{keyID}.json".
+const keysDir = "keys"
+
+func (p *DiskProvider) keyPath(id string) string {
+	return filepath.Join(p.dir, keysDir, id+".json")
+}
+
+// CreateKey generates a new KeyID/secret pair, persists the Key with the
+// secret's hash, and returns the Key alongside the plaintext secret.
+func (p *DiskProvider) CreateKey(capabilities []string, bucketName, keyPrefix string, expiresAt time.Time) (*Key, string, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	k := &Key{
+		KeyID:        id,
+		SecretHash:   hashSecret(secret),
+		Capabilities: capabilities,
+		BucketName:   bucketName,
+		KeyPrefix:    keyPrefix,
+		ExpiresAt:    expiresAt,
+	}
+
+	if err := os.MkdirAll(filepath.Join(p.dir, keysDir), 0755); err != nil {
+		return nil, "", err
+	}
+
+	buf, err := json.Marshal(k)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := ioutil.WriteFile(p.keyPath(id), buf, 0600); err != nil {
+		return nil, "", err
+	}
+
+	return k, secret, nil
+}
+
+// DeleteKey removes the key identified by id.
+func (p *DiskProvider) DeleteKey(id string) error {
+	err := os.Remove(p.keyPath(id))
+	if os.IsNotExist(err) {
+		return ErrKeyNotFound
+	}
+	return err
+}
+
+// AuthorizeKey loads the key identified by id, checks secret against its
+// stored hash in constant time, and verifies it grants cap on bucket/key.
+func (p *DiskProvider) AuthorizeKey(id, secret, bucket, key, cap string) (*Key, error) {
+	buf, err := ioutil.ReadFile(p.keyPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var k Key
+	if err := json.Unmarshal(buf, &k); err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(k.SecretHash)) != 1 {
+		return nil, ErrUnauthorized
+	}
+	if k.expired() {
+		return nil, ErrUnauthorized
+	}
+	if !k.allows(bucket, key, cap) {
+		return nil, ErrForbidden
+	}
+
+	return &k, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
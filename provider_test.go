@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestKeyAllows(t *testing.T) {
+	cases := []struct {
+		name   string
+		key    Key
+		bucket string
+		key2   string
+		cap    string
+		want   bool
+	}{
+		{
+			name:   "unscoped key grants any bucket/key",
+			key:    Key{Capabilities: []string{CapRead}},
+			bucket: "photos",
+			key2:   "a.jpg",
+			cap:    CapRead,
+			want:   true,
+		},
+		{
+			name:   "missing capability is denied",
+			key:    Key{Capabilities: []string{CapRead}},
+			bucket: "photos",
+			key2:   "a.jpg",
+			cap:    CapWrite,
+			want:   false,
+		},
+		{
+			name:   "bucket scope rejects other buckets",
+			key:    Key{Capabilities: []string{CapRead}, BucketName: "photos"},
+			bucket: "other-bucket",
+			key2:   "a.jpg",
+			cap:    CapRead,
+			want:   false,
+		},
+		{
+			name:   "key prefix rejects keys outside it",
+			key:    Key{Capabilities: []string{CapRead}, KeyPrefix: "avatars/"},
+			bucket: "photos",
+			key2:   "uploads/file",
+			cap:    CapRead,
+			want:   false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.key.allows(c.bucket, c.key2, c.cap); got != c.want {
+				t.Errorf("allows(%q, %q, %q) = %v, want %v", c.bucket, c.key2, c.cap, got, c.want)
+			}
+		})
+	}
+}
+
+func TestKeyExpired(t *testing.T) {
+	k := Key{ExpiresAt: time.Now().Add(-time.Minute)}
+	if !k.expired() {
+		t.Error("key with a past ExpiresAt should be expired")
+	}
+
+	k = Key{ExpiresAt: time.Now().Add(time.Minute)}
+	if k.expired() {
+		t.Error("key with a future ExpiresAt should not be expired")
+	}
+
+	k = Key{}
+	if k.expired() {
+		t.Error("key with a zero ExpiresAt should never expire")
+	}
+}
+
+func TestDiskProviderAuthorizeKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ent-provider-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p, err := NewDiskProvider(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, secret, err := p.CreateKey([]string{CapRead}, "photos", "", time.Time{})
+	if err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+
+	if _, err := p.AuthorizeKey(k.KeyID, secret, "photos", "a.jpg", CapRead); err != nil {
+		t.Errorf("AuthorizeKey with the right secret and capability: %v", err)
+	}
+
+	if _, err := p.AuthorizeKey(k.KeyID, "wrong-secret", "photos", "a.jpg", CapRead); err != ErrUnauthorized {
+		t.Errorf("AuthorizeKey with a wrong secret = %v, want ErrUnauthorized", err)
+	}
+
+	if _, err := p.AuthorizeKey(k.KeyID, secret, "photos", "a.jpg", CapWrite); err != ErrForbidden {
+		t.Errorf("AuthorizeKey for an ungranted capability = %v, want ErrForbidden", err)
+	}
+
+	if _, err := p.AuthorizeKey(k.KeyID, secret, "other-bucket", "a.jpg", CapRead); err != ErrForbidden {
+		t.Errorf("AuthorizeKey against a different bucket = %v, want ErrForbidden", err)
+	}
+
+	if err := p.DeleteKey(k.KeyID); err != nil {
+		t.Fatalf("DeleteKey: %v", err)
+	}
+
+	if _, err := p.AuthorizeKey(k.KeyID, secret, "photos", "a.jpg", CapRead); err != ErrUnauthorized {
+		t.Errorf("AuthorizeKey after DeleteKey = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestDiskProviderDeleteKeyNotFound(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ent-provider-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p, err := NewDiskProvider(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.DeleteKey("does-not-exist"); err != ErrKeyNotFound {
+		t.Errorf("DeleteKey for an unknown id = %v, want ErrKeyNotFound", err)
+	}
+}
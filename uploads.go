@@ -0,0 +1,174 @@
+// Copyright (c) 2014, SoundCloud Ltd.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/ent
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soundcloud/ent/fs"
+)
+
+// ErrHashMismatch is returned when a client-supplied SHA1 (on a single-shot
+// upload or a part) doesn't match the one ent computed over the bytes it
+// received.
+var ErrHashMismatch = errors.New("sha1 mismatch")
+
+// ResponseUploadCreated is the response to POST /{bucket}/{key}?uploads=1.
+type ResponseUploadCreated struct {
+	UploadID string `json:"upload_id"`
+}
+
+func handleUploadCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		began := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() { reportMetrics(rec, r, nil, nil, began, "handleUploadCreate") }()
+
+		id, err := randomToken(16)
+		if err != nil {
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		rec.Header().Set("Content-Type", "application/json")
+		rec.WriteHeader(http.StatusCreated)
+		json.NewEncoder(rec).Encode(ResponseUploadCreated{UploadID: id})
+	}
+}
+
+func handlePutPart(p Provider, fss *backendSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			began    = time.Now()
+			bucket   = r.URL.Query().Get(":bucket")
+			key      = r.URL.Query().Get(":key")
+			uploadID = r.URL.Query().Get("uploadID")
+			b        *Bucket
+			rd       *ReaderDelegator
+		)
+		defer r.Body.Close()
+
+		ctx, cancel := requestContext(r)
+		defer cancel()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() { reportMetrics(rec, r, rd, b, began, "handlePutPart") }()
+
+		part, err := strconv.Atoi(r.URL.Query().Get("part"))
+		if err != nil {
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		b, err = p.Get(bucket)
+		if err != nil {
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		bfs, err := fss.forBucket(b)
+		if err != nil {
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		rd = NewReaderDelegator(r.Body)
+		got, err := bfs.CreatePart(ctx, b.Name, key, uploadID, part, rd)
+		if err != nil {
+			trackCancellation(err, "handlePutPart")
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		if expected := r.Header.Get("X-Ent-Part-SHA1"); expected != "" && !strings.EqualFold(hex.EncodeToString(got), expected) {
+			bfs.DeletePart(ctx, b.Name, key, uploadID, part)
+			respondError(rec, r.Method, r.URL.String(), ErrHashMismatch)
+			return
+		}
+
+		rec.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// requestFinalize is the body accepted by POST
+// /{bucket}/{key}?uploadID=...&finalize=1: the ordered list of parts
+// making up the final file.
+type requestFinalize struct {
+	Parts []requestFinalizePart `json:"parts"`
+}
+
+type requestFinalizePart struct {
+	Number int    `json:"number"`
+	SHA1   string `json:"sha1"`
+}
+
+func handleUploadFinalize(p Provider, fss *backendSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			began    = time.Now()
+			bucket   = r.URL.Query().Get(":bucket")
+			key      = r.URL.Query().Get(":key")
+			uploadID = r.URL.Query().Get("uploadID")
+			b        *Bucket
+		)
+		defer r.Body.Close()
+
+		ctx, cancel := requestContext(r)
+		defer cancel()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() { reportMetrics(rec, r, nil, b, began, "handleUploadFinalize") }()
+
+		var req requestFinalize
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		parts := make([]fs.Part, len(req.Parts))
+		for i, rp := range req.Parts {
+			h, err := hex.DecodeString(rp.SHA1)
+			if err != nil {
+				respondError(rec, r.Method, r.URL.String(), err)
+				return
+			}
+			parts[i] = fs.Part{Number: rp.Number, SHA1: h}
+		}
+
+		var err error
+		b, err = p.Get(bucket)
+		if err != nil {
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		bfs, err := fss.forBucket(b)
+		if err != nil {
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		f, err := bfs.Finalize(ctx, b.Name, key, uploadID, parts)
+		if err != nil {
+			trackCancellation(err, "handleUploadFinalize")
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+		h, err := f.Hash()
+		if err != nil {
+			respondError(rec, r.Method, r.URL.String(), err)
+			return
+		}
+
+		respondCreated(rec, b, key, h, began)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soundcloud/ent/fs"
+)
+
+// fakeProvider is a Provider stub that always resolves to a single fixed
+// Bucket; the key-management methods aren't exercised by the handler tests
+// in this file.
+type fakeProvider struct {
+	bucket *Bucket
+}
+
+func (p *fakeProvider) Get(name string) (*Bucket, error) { return p.bucket, nil }
+func (p *fakeProvider) List() ([]*Bucket, error)          { return []*Bucket{p.bucket}, nil }
+func (p *fakeProvider) CreateKey(caps []string, bucketName, keyPrefix string, expiresAt time.Time) (*Key, string, error) {
+	return nil, "", nil
+}
+func (p *fakeProvider) DeleteKey(id string) error { return nil }
+func (p *fakeProvider) AuthorizeKey(id, secret, bucket, key, cap string) (*Key, error) {
+	return nil, nil
+}
+
+// newTestFixture returns a fakeProvider/backendSet pair backed by a Disk
+// FileSystem rooted at a fresh temp directory, and that root directory.
+func newTestFixture(t *testing.T) (*fakeProvider, *backendSet, string) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "ent-uploads-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	p := &fakeProvider{bucket: &Bucket{Name: "photos", Policy: &Policy{Backend: "disk"}}}
+	fss := newBackendSet("disk", fs.Config{Disk: fs.DiskConfig{Root: dir}})
+
+	return p, fss, dir
+}
+
+func TestHandlePutPartHashMismatchRemovesStagedPart(t *testing.T) {
+	p, fss, dir := newTestFixture(t)
+
+	r := httptest.NewRequest("PUT", "/photos/a.jpg?:bucket=photos&:key=a.jpg&uploadID=up1&part=1", strings.NewReader("data"))
+	r.Header.Set("X-Ent-Part-SHA1", "0000000000000000000000000000000000000000")
+	w := httptest.NewRecorder()
+
+	handlePutPart(p, fss)(w, r)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "uploads", "up1", "1")); !os.IsNotExist(err) {
+		t.Errorf("staged part should have been removed after the SHA1 mismatch, stat err = %v", err)
+	}
+}
+
+func TestHandlePutPartSuccess(t *testing.T) {
+	p, fss, dir := newTestFixture(t)
+
+	r := httptest.NewRequest("PUT", "/photos/a.jpg?:bucket=photos&:key=a.jpg&uploadID=up2&part=1", strings.NewReader("data"))
+	w := httptest.NewRecorder()
+
+	handlePutPart(p, fss)(w, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "uploads", "up2", "1")); err != nil {
+		t.Errorf("staged part should exist after a successful PutPart: %v", err)
+	}
+}
+
+func TestHandleUploadFinalize(t *testing.T) {
+	p, fss, _ := newTestFixture(t)
+
+	putR := httptest.NewRequest("PUT", "/photos/a.jpg?:bucket=photos&:key=a.jpg&uploadID=up3&part=1", strings.NewReader("hello, world"))
+	putW := httptest.NewRecorder()
+	handlePutPart(p, fss)(putW, putR)
+	if putW.Code != http.StatusNoContent {
+		t.Fatalf("PutPart status = %d, want %d", putW.Code, http.StatusNoContent)
+	}
+
+	sum := sha1Hex(t, "hello, world")
+	body, err := json.Marshal(requestFinalize{Parts: []requestFinalizePart{{Number: 1, SHA1: sum}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	finR := httptest.NewRequest("POST", "/photos/a.jpg?:bucket=photos&:key=a.jpg&uploadID=up3&finalize=1", strings.NewReader(string(body)))
+	finW := httptest.NewRecorder()
+	handleUploadFinalize(p, fss)(finW, finR)
+
+	if finW.Code != http.StatusCreated {
+		t.Fatalf("Finalize status = %d, want %d, body = %s", finW.Code, http.StatusCreated, finW.Body.String())
+	}
+
+	var resp ResponseCreated
+	if err := json.Unmarshal(finW.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(resp.File.SHA1); got != sum {
+		t.Errorf("finalized SHA1 = %s, want %s", got, sum)
+	}
+}
+
+func sha1Hex(t *testing.T, s string) string {
+	t.Helper()
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}